@@ -0,0 +1,536 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock_gcs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	gcs "github.com/jacobsa/gcloud/gcs"
+	oglemock "github.com/jacobsa/oglemock"
+	context "golang.org/x/net/context"
+	storage "google.golang.org/cloud/storage"
+)
+
+// MatchMode controls how a replay bucket created with NewReplayBucket
+// matches incoming calls against a recorded log.
+type MatchMode int
+
+const (
+	// Strict requires calls to arrive in exactly the order they were
+	// recorded, one for one. This is only meaningful for a recording made
+	// by a single goroutine driving the bucket serially: if two or more of
+	// the real bucket's methods were ever in flight at once while
+	// recording (e.g. StatObject/NewReader calls fanned out by
+	// syncutil.Bundle workers over an object listing), the recorded order
+	// just reflects goroutine scheduling rather than any fixed logical
+	// order, and replaying that same concurrent workload in Strict mode
+	// will spuriously panic. NewReplayBucket refuses to open a recording
+	// known to have been made concurrently in Strict mode; use Loose for
+	// those.
+	Strict MatchMode = iota
+
+	// Loose only requires that an unconsumed call with a matching method
+	// name and request type remain in the log; argument values and call
+	// order are not checked. This is the right mode for recordings made
+	// by concurrent callers, since it does not depend on a fixed order.
+	Loose
+)
+
+// recordingVersion is bumped whenever the on-disk format below changes in
+// an incompatible way.
+const recordingVersion = 1
+
+// recordedCall is one (method, request, response) tuple captured from a
+// real bucket.
+type recordedCall struct {
+	Method   string
+	Request  interface{}
+	Response interface{}
+	ErrMsg   string // empty if the call did not return an error
+	Body     []byte // captured NewReader contents, if Method == "NewReader"
+}
+
+// recording is the gob-encoded representation of a recorded session,
+// written by a recordingBucket on Close and read by NewReplayBucket.
+type recording struct {
+	Version int
+	Calls   []recordedCall
+
+	// Concurrent is true if two or more calls to the real bucket were ever
+	// observed in flight at once while recording, meaning Calls's order is
+	// an artifact of goroutine scheduling rather than a fixed logical
+	// order. See the Strict doc comment on MatchMode.
+	Concurrent bool
+}
+
+func init() {
+	gob.Register(&gcs.CreateObjectRequest{})
+	gob.Register(&gcs.StatObjectRequest{})
+	gob.Register(&gcs.UpdateObjectRequest{})
+	gob.Register(&storage.Query{})
+	gob.Register(&storage.Object{})
+	gob.Register(&storage.Objects{})
+}
+
+func errMsg(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func errFromMsg(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
+
+// responseOrNil returns resp, unless err is non-nil, in which case it
+// returns a true nil interface rather than resp's possibly-typed-nil
+// pointer. gob refuses to encode a nil pointer boxed in an interface{}
+// field, which is exactly what a failed call (e.g. StatObject on a missing
+// object) would otherwise leave in recordedCall.Response.
+func responseOrNil(resp interface{}, err error) interface{} {
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+////////////////////////////////////////////////////////////////////////
+// Recording
+////////////////////////////////////////////////////////////////////////
+
+// RecordingBucket is a gcs.Bucket that transparently proxies every call to
+// a real bucket while recording it, plus the ability to flush that
+// recording to disk.
+type RecordingBucket interface {
+	MockBucket
+	io.Closer
+}
+
+// recordingBucket proxies every call to a real gcs.Bucket, accumulating a
+// log of (method, args, results) tuples that Close writes out.
+type recordingBucket struct {
+	real gcs.Bucket
+	path string
+
+	mu         sync.Mutex
+	calls      []recordedCall // GUARDED_BY(mu)
+	concurrent bool           // GUARDED_BY(mu); see recording.Concurrent
+
+	inFlight int32 // Accessed atomically; number of calls to real in progress.
+}
+
+// begin records the start of a call to the real bucket, returning a func to
+// be called on its completion. If more than one call is ever observed in
+// flight at once, the recording is marked as concurrent for the benefit of
+// NewReplayBucket's Strict mode check.
+func (b *recordingBucket) begin() (end func()) {
+	if atomic.AddInt32(&b.inFlight, 1) > 1 {
+		b.mu.Lock()
+		b.concurrent = true
+		b.mu.Unlock()
+	}
+
+	return func() {
+		atomic.AddInt32(&b.inFlight, -1)
+	}
+}
+
+// NewRecordingBucket returns a gcs.Bucket that transparently proxies every
+// call to real, recording the method, arguments, and results of each. Call
+// Close when done exercising it to write the recording to path, where it
+// can later be fed to NewReplayBucket to run the same interaction
+// hermetically.
+func NewRecordingBucket(real gcs.Bucket, path string) RecordingBucket {
+	return &recordingBucket{
+		real: real,
+		path: path,
+	}
+}
+
+func (b *recordingBucket) Oglemock_Id() uintptr {
+	return uintptr(unsafe.Pointer(b))
+}
+
+func (b *recordingBucket) Oglemock_Description() string {
+	return fmt.Sprintf("recording bucket backed by %q", b.real.Name())
+}
+
+func (b *recordingBucket) record(c recordedCall) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, c)
+}
+
+// Close serializes every call recorded so far to the path given to
+// NewRecordingBucket.
+func (b *recordingBucket) Close() (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f, err := os.Create(b.path)
+	if err != nil {
+		err = fmt.Errorf("creating recording file: %v", err)
+		return
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	rec := recording{
+		Version:    recordingVersion,
+		Calls:      b.calls,
+		Concurrent: b.concurrent,
+	}
+	if err = gob.NewEncoder(f).Encode(&rec); err != nil {
+		err = fmt.Errorf("encoding recording: %v", err)
+		return
+	}
+
+	return
+}
+
+func (b *recordingBucket) Name() (name string) {
+	defer b.begin()()
+
+	name = b.real.Name()
+	b.record(recordedCall{Method: "Name", Response: name})
+	return
+}
+
+func (b *recordingBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *storage.Object, err error) {
+	defer b.begin()()
+
+	o, err = b.real.CreateObject(ctx, req)
+	b.record(recordedCall{
+		Method:   "CreateObject",
+		Request:  req,
+		Response: responseOrNil(o, err),
+		ErrMsg:   errMsg(err),
+	})
+	return
+}
+
+func (b *recordingBucket) DeleteObject(
+	ctx context.Context,
+	name string) (err error) {
+	defer b.begin()()
+
+	err = b.real.DeleteObject(ctx, name)
+	b.record(recordedCall{
+		Method:  "DeleteObject",
+		Request: name,
+		ErrMsg:  errMsg(err),
+	})
+	return
+}
+
+func (b *recordingBucket) ListObjects(
+	ctx context.Context,
+	query *storage.Query) (o *storage.Objects, err error) {
+	defer b.begin()()
+
+	o, err = b.real.ListObjects(ctx, query)
+	b.record(recordedCall{
+		Method:   "ListObjects",
+		Request:  query,
+		Response: responseOrNil(o, err),
+		ErrMsg:   errMsg(err),
+	})
+	return
+}
+
+func (b *recordingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (o *storage.Object, err error) {
+	defer b.begin()()
+
+	o, err = b.real.StatObject(ctx, req)
+	b.record(recordedCall{
+		Method:   "StatObject",
+		Request:  req,
+		Response: responseOrNil(o, err),
+		ErrMsg:   errMsg(err),
+	})
+	return
+}
+
+func (b *recordingBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *storage.Object, err error) {
+	defer b.begin()()
+
+	o, err = b.real.UpdateObject(ctx, req)
+	b.record(recordedCall{
+		Method:   "UpdateObject",
+		Request:  req,
+		Response: responseOrNil(o, err),
+		ErrMsg:   errMsg(err),
+	})
+	return
+}
+
+// teeReadCloser tees everything read from a real object body into an
+// in-memory buffer, recording the accumulated bytes when the caller closes
+// it.
+type teeReadCloser struct {
+	io.Reader
+	real    io.ReadCloser
+	buf     *bytes.Buffer
+	onClose func(body []byte, closeErr error)
+}
+
+func (t *teeReadCloser) Close() error {
+	// Drain whatever the caller didn't read, so the recording holds the
+	// full body even if the caller closed early (e.g. after sniffing the
+	// first few bytes). Best-effort: a draining error just means a
+	// truncated recording, not a failure to close.
+	io.Copy(ioutil.Discard, t.Reader)
+
+	closeErr := t.real.Close()
+	t.onClose(t.buf.Bytes(), closeErr)
+	return closeErr
+}
+
+func (b *recordingBucket) NewReader(
+	ctx context.Context,
+	objName string) (rc io.ReadCloser, err error) {
+	// The call is considered in flight until the returned reader is closed,
+	// since that's how long the real bucket's underlying stream stays open.
+	end := b.begin()
+
+	real, err := b.real.NewReader(ctx, objName)
+	if err != nil {
+		end()
+		b.record(recordedCall{
+			Method:  "NewReader",
+			Request: objName,
+			ErrMsg:  errMsg(err),
+		})
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	rc = &teeReadCloser{
+		Reader: io.TeeReader(real, buf),
+		real:   real,
+		buf:    buf,
+		onClose: func(body []byte, closeErr error) {
+			end()
+			b.record(recordedCall{
+				Method:  "NewReader",
+				Request: objName,
+				Body:    body,
+				ErrMsg:  errMsg(closeErr),
+			})
+		},
+	}
+
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Replay
+////////////////////////////////////////////////////////////////////////
+
+// replayBucket serves gcs.Bucket calls from a log previously captured by a
+// recordingBucket, rather than hitting GCS.
+type replayBucket struct {
+	mode  MatchMode
+	mu    sync.Mutex
+	calls []recordedCall // GUARDED_BY(mu)
+}
+
+// NewReplayBucket returns a gcs.Bucket that replays the calls recorded to
+// path by NewRecordingBucket, so that a real GCS interaction captured once
+// can drive a test hermetically and repeatedly. It panics if path cannot be
+// read, does not contain a recording of a version it understands, or if
+// mode is Strict but the recording was made with overlapping calls to the
+// real bucket (see the Strict doc comment on MatchMode) -- use Loose for
+// those.
+func NewReplayBucket(path string, mode MatchMode) MockBucket {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(fmt.Sprintf("mock_gcs: opening recording: %v", err))
+	}
+	defer f.Close()
+
+	var rec recording
+	if err := gob.NewDecoder(f).Decode(&rec); err != nil {
+		panic(fmt.Sprintf("mock_gcs: decoding recording: %v", err))
+	}
+
+	if rec.Version != recordingVersion {
+		panic(fmt.Sprintf(
+			"mock_gcs: recording %q has version %d, want %d",
+			path, rec.Version, recordingVersion))
+	}
+
+	if mode == Strict && rec.Concurrent {
+		panic(fmt.Sprintf(
+			"mock_gcs: recording %q was made with overlapping calls to the "+
+				"real bucket, so its order isn't stable enough for Strict "+
+				"matching; use Loose instead",
+			path))
+	}
+
+	return &replayBucket{mode: mode, calls: rec.Calls}
+}
+
+// nextCall returns and consumes the next recorded call for method given
+// req, the request the caller actually passed. In Strict mode req must be
+// deeply equal to the request that was recorded; in Loose mode only its
+// type (the argument "shape") must match. It panics if no matching call is
+// available.
+func (b *replayBucket) nextCall(method string, req interface{}) recordedCall {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.mode == Strict {
+		if len(b.calls) == 0 {
+			panic(fmt.Sprintf("mock_gcs: no more recorded calls, got %s", method))
+		}
+
+		c := b.calls[0]
+		if c.Method != method {
+			panic(fmt.Sprintf("mock_gcs: expected %s, got %s", c.Method, method))
+		}
+		if !reflect.DeepEqual(c.Request, req) {
+			panic(fmt.Sprintf(
+				"mock_gcs: %s called with %#v, want %#v", method, req, c.Request))
+		}
+
+		b.calls = b.calls[1:]
+		return c
+	}
+
+	for i, c := range b.calls {
+		if c.Method != method {
+			continue
+		}
+		if reflect.TypeOf(c.Request) != reflect.TypeOf(req) {
+			continue
+		}
+
+		b.calls = append(b.calls[:i:i], b.calls[i+1:]...)
+		return c
+	}
+
+	panic(fmt.Sprintf("mock_gcs: no recorded call for %s", method))
+}
+
+func (b *replayBucket) Oglemock_Id() uintptr {
+	return uintptr(unsafe.Pointer(b))
+}
+
+func (b *replayBucket) Oglemock_Description() string {
+	return "replay bucket"
+}
+
+func (b *replayBucket) Name() string {
+	c := b.nextCall("Name", nil)
+	if c.Response == nil {
+		return ""
+	}
+	return c.Response.(string)
+}
+
+func (b *replayBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (o *storage.Object, err error) {
+	c := b.nextCall("CreateObject", req)
+	if c.Response != nil {
+		o = c.Response.(*storage.Object)
+	}
+	err = errFromMsg(c.ErrMsg)
+	return
+}
+
+func (b *replayBucket) DeleteObject(
+	ctx context.Context,
+	name string) error {
+	c := b.nextCall("DeleteObject", name)
+	return errFromMsg(c.ErrMsg)
+}
+
+func (b *replayBucket) ListObjects(
+	ctx context.Context,
+	query *storage.Query) (o *storage.Objects, err error) {
+	c := b.nextCall("ListObjects", query)
+	if c.Response != nil {
+		o = c.Response.(*storage.Objects)
+	}
+	err = errFromMsg(c.ErrMsg)
+	return
+}
+
+func (b *replayBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (o *storage.Object, err error) {
+	c := b.nextCall("StatObject", req)
+	if c.Response != nil {
+		o = c.Response.(*storage.Object)
+	}
+	err = errFromMsg(c.ErrMsg)
+	return
+}
+
+func (b *replayBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (o *storage.Object, err error) {
+	c := b.nextCall("UpdateObject", req)
+	if c.Response != nil {
+		o = c.Response.(*storage.Object)
+	}
+	err = errFromMsg(c.ErrMsg)
+	return
+}
+
+func (b *replayBucket) NewReader(
+	ctx context.Context,
+	objName string) (rc io.ReadCloser, err error) {
+	c := b.nextCall("NewReader", objName)
+	if err = errFromMsg(c.ErrMsg); err != nil {
+		return
+	}
+
+	rc = ioutil.NopCloser(bytes.NewReader(c.Body))
+	return
+}
+
+// Ensure the mock object methods satisfy oglemock's interface, matching
+// the convention of the generated MockBucket above.
+var (
+	_ oglemock.MockObject = (*recordingBucket)(nil)
+	_ oglemock.MockObject = (*replayBucket)(nil)
+)
@@ -0,0 +1,215 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock_gcs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	gcs "github.com/jacobsa/gcloud/gcs"
+	context "golang.org/x/net/context"
+	storage "google.golang.org/cloud/storage"
+)
+
+// fakeBucket is a minimal gcs.Bucket used to drive a recordingBucket in
+// tests without talking to real GCS.
+type fakeBucket struct {
+	name string
+
+	statErr error
+
+	// If non-nil, StatObject calls Done on statBarrier and then waits for it,
+	// so that concurrent callers are all in flight at once.
+	statBarrier *sync.WaitGroup
+}
+
+func (b *fakeBucket) Name() string {
+	return b.name
+}
+
+func (b *fakeBucket) CreateObject(
+	ctx context.Context,
+	req *gcs.CreateObjectRequest) (*storage.Object, error) {
+	return &storage.Object{}, nil
+}
+
+func (b *fakeBucket) DeleteObject(ctx context.Context, name string) error {
+	return nil
+}
+
+func (b *fakeBucket) ListObjects(
+	ctx context.Context,
+	query *storage.Query) (*storage.Objects, error) {
+	return &storage.Objects{}, nil
+}
+
+func (b *fakeBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*storage.Object, error) {
+	if b.statBarrier != nil {
+		b.statBarrier.Done()
+		b.statBarrier.Wait()
+	}
+
+	if b.statErr != nil {
+		return nil, b.statErr
+	}
+	return &storage.Object{}, nil
+}
+
+func (b *fakeBucket) UpdateObject(
+	ctx context.Context,
+	req *gcs.UpdateObjectRequest) (*storage.Object, error) {
+	return &storage.Object{}, nil
+}
+
+func (b *fakeBucket) NewReader(
+	ctx context.Context,
+	objName string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("contents of " + objName)), nil
+}
+
+func TestRecordReplayRoundTripStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+
+	real := &fakeBucket{name: "bucket", statErr: errors.New("not found")}
+	rb := NewRecordingBucket(real, path)
+
+	ctx := context.Background()
+	if got := rb.Name(); got != "bucket" {
+		t.Errorf("Name() = %q, want bucket", got)
+	}
+
+	if _, err := rb.StatObject(ctx, &gcs.StatObjectRequest{}); err == nil {
+		t.Fatal("expected StatObject to return the recorded error")
+	}
+
+	rc, err := rb.NewReader(ctx, "foo")
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if err := rb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	replay := NewReplayBucket(path, Strict)
+
+	if got := replay.Name(); got != "bucket" {
+		t.Errorf("replayed Name() = %q, want bucket", got)
+	}
+
+	if _, err := replay.StatObject(ctx, &gcs.StatObjectRequest{}); err == nil {
+		t.Error("expected replayed StatObject to return the recorded error")
+	}
+
+	rc, err = replay.NewReader(ctx, "foo")
+	if err != nil {
+		t.Fatalf("replayed NewReader: %v", err)
+	}
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading replayed body: %v", err)
+	}
+	if string(body) != "contents of foo" {
+		t.Errorf("replayed body = %q, want %q", body, "contents of foo")
+	}
+}
+
+func TestRecordReplayRoundTripLoose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+
+	// Fan the calls out concurrently, the way syncutil.Bundle workers would,
+	// holding each in flight until all have started so the recording ends up
+	// marked Concurrent.
+	names := []string{"a", "b", "c"}
+	barrier := new(sync.WaitGroup)
+	barrier.Add(len(names))
+
+	real := &fakeBucket{name: "bucket", statBarrier: barrier}
+	rb := NewRecordingBucket(real, path)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, n := range names {
+		n := n
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rb.StatObject(ctx, &gcs.StatObjectRequest{}); err != nil {
+				t.Errorf("StatObject(%s): %v", n, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := rb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Replaying out of the original order should still work in Loose mode.
+	replay := NewReplayBucket(path, Loose)
+	for range names {
+		if _, err := replay.StatObject(ctx, &gcs.StatObjectRequest{}); err != nil {
+			t.Errorf("replayed StatObject: %v", err)
+		}
+	}
+}
+
+func TestReplayStrictRejectsConcurrentRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+
+	// Hold both calls in flight until both have started, so that they are
+	// observed overlapping.
+	barrier := new(sync.WaitGroup)
+	barrier.Add(2)
+
+	real := &fakeBucket{name: "bucket", statBarrier: barrier}
+	rb := NewRecordingBucket(real, path)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rb.StatObject(ctx, &gcs.StatObjectRequest{})
+		}()
+	}
+	wg.Wait()
+
+	if err := rb.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewReplayBucket(Strict) to panic on a concurrent recording")
+		}
+	}()
+
+	NewReplayBucket(path, Strict)
+}
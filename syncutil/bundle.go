@@ -4,6 +4,9 @@
 package syncutil
 
 import (
+	"fmt"
+	"runtime/debug"
+	"strings"
 	"sync"
 
 	"golang.org/x/net/context"
@@ -60,21 +63,140 @@ type Bundle struct {
 
 	errorOnce  sync.Once
 	firstError error
+
+	semMu sync.Mutex
+	sem   chan struct{} // GUARDED_BY(semMu); nil means unlimited
+
+	errMu      sync.Mutex
+	collectAll bool    // GUARDED_BY(errMu)
+	added      bool    // GUARDED_BY(errMu); true once a function has been added
+	errs       []error // GUARDED_BY(errMu)
+}
+
+// CollectAllErrors switches the bundle into a mode where every non-nil
+// error returned by an added function is retained, rather than just the
+// first. In this mode Join returns an error that concatenates all of them
+// and supports Unwrap() []error, and Errors returns the full list.
+// CollectAllErrors panics if a function has already been added, since such a
+// function may already be running (or have already returned) without its
+// error having been retained.
+func (b *Bundle) CollectAllErrors() {
+	b.errMu.Lock()
+	defer b.errMu.Unlock()
+
+	if b.added {
+		panic("syncutil.Bundle.CollectAllErrors: called after a function was already added")
+	}
+
+	b.collectAll = true
 }
 
-// XXX: Comments
+// Errors returns every non-nil error returned so far by functions added to
+// the bundle. It is only populated in AllErrors mode; see CollectAllErrors.
+func (b *Bundle) Errors() []error {
+	b.errMu.Lock()
+	defer b.errMu.Unlock()
+
+	return append([]error(nil), b.errs...)
+}
+
+// SetLimit caps the number of functions added with Add or TryAdd that may
+// be running concurrently at n. It may be called at any time, including
+// before any calls to Add, and affects only functions added afterward.
+//
+// SetLimit(-1) removes the cap, restoring the default unlimited behavior.
+// SetLimit panics if n is zero.
+func (b *Bundle) SetLimit(n int) {
+	if n == 0 {
+		panic("syncutil.Bundle.SetLimit: n must not be zero")
+	}
+
+	b.semMu.Lock()
+	defer b.semMu.Unlock()
+
+	if n < 0 {
+		b.sem = nil
+		return
+	}
+
+	b.sem = make(chan struct{}, n)
+}
+
+// getSem returns the current semaphore, if any limit is in effect.
+func (b *Bundle) getSem() chan struct{} {
+	b.semMu.Lock()
+	defer b.semMu.Unlock()
+	return b.sem
+}
+
+// Add runs f in a new goroutine, waiting for a free slot first if a limit
+// has been set with SetLimit. If the bundle's context is cancelled while
+// waiting for a slot, f is invoked anyway -- without occupying a slot -- so
+// that it has a chance to observe the cancellation rather than blocking
+// forever.
 func (b *Bundle) Add(f func(context.Context) error) {
+	sem := b.getSem()
+
+	var acquired bool
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+			acquired = true
+		case <-b.context.Done():
+		}
+	}
+
+	b.run(f, sem, acquired)
+}
+
+// TryAdd is like Add, but only launches f if a slot is immediately
+// available; otherwise it returns false without running f. If no limit has
+// been set, a slot is always available and TryAdd always returns true.
+func (b *Bundle) TryAdd(f func(context.Context) error) bool {
+	sem := b.getSem()
+
+	if sem == nil {
+		b.run(f, sem, false)
+		return true
+	}
+
+	select {
+	case sem <- struct{}{}:
+		b.run(f, sem, true)
+		return true
+
+	default:
+		return false
+	}
+}
+
+// run launches f in the background, releasing the semaphore slot held on
+// its behalf (if any) once it completes.
+func (b *Bundle) run(f func(context.Context) error, sem chan struct{}, acquired bool) {
+	b.errMu.Lock()
+	b.added = true
+	b.errMu.Unlock()
+
 	b.waitGroup.Add(1)
 
-	// Run the function in the background.
 	go func() {
 		defer b.waitGroup.Done()
 
-		err := f(b.context)
+		if acquired {
+			defer func() { <-sem }()
+		}
+
+		err := b.invoke(f)
 		if err == nil {
 			return
 		}
 
+		b.errMu.Lock()
+		if b.collectAll {
+			b.errs = append(b.errs, err)
+		}
+		b.errMu.Unlock()
+
 		// On first error, cancel the context and save the error.
 		b.errorOnce.Do(func() {
 			b.firstError = err
@@ -83,10 +205,59 @@ func (b *Bundle) Add(f func(context.Context) error) {
 	}()
 }
 
-// XXX: Comments
+// invoke runs f, recovering any panic and converting it to an error
+// carrying the goroutine's stack trace so that it can surface through
+// Join instead of crashing the process.
+func (b *Bundle) invoke(f func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in Bundle function: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	err = f(b.context)
+	return
+}
+
+// Join waits for all functions added to the bundle to return, then reports
+// their status. In the default mode this is the first error returned by
+// any function (nil if none failed). In AllErrors mode (see
+// CollectAllErrors) it is instead an error aggregating every failure,
+// supporting Unwrap() []error.
 func (b *Bundle) Join() error {
 	b.waitGroup.Wait()
-	return b.firstError
+
+	b.errMu.Lock()
+	defer b.errMu.Unlock()
+
+	if !b.collectAll {
+		return b.firstError
+	}
+
+	if len(b.errs) == 0 {
+		return nil
+	}
+
+	return &bundleError{errs: append([]error(nil), b.errs...)}
+}
+
+// bundleError aggregates multiple errors returned from a bundle in
+// AllErrors mode.
+type bundleError struct {
+	errs []error
+}
+
+func (e *bundleError) Error() string {
+	parts := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		parts[i] = err.Error()
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func (e *bundleError) Unwrap() []error {
+	return e.errs
 }
 
 // XXX: Comments for interface and impl
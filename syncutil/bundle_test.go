@@ -0,0 +1,200 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncutil
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestBundleSetLimitRespectsLimit(t *testing.T) {
+	b := NewBundle(nil)
+	b.SetLimit(2)
+
+	const n = 20
+	var cur, peak int32
+	release := make(chan struct{})
+
+	// Add blocks the calling goroutine until a slot is free, so issue all n
+	// calls concurrently rather than looping over Add directly; otherwise
+	// this goroutine would itself deadlock waiting for a slot that nothing
+	// else is around to free up.
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			b.Add(func(ctx context.Context) error {
+				c := atomic.AddInt32(&cur, 1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if c <= p || atomic.CompareAndSwapInt32(&peak, p, c) {
+						break
+					}
+				}
+
+				<-release
+				atomic.AddInt32(&cur, -1)
+				return nil
+			})
+		}()
+	}
+
+	// Give every Add a chance to pile up against the limit before releasing
+	// them all at once.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if err := b.Join(); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+
+	if peak > 2 {
+		t.Errorf("peak concurrency = %d, want <= 2", peak)
+	}
+}
+
+func TestBundleAddRunsAfterCancellation(t *testing.T) {
+	b := NewBundle(nil)
+
+	// Added before any limit is set, so this function occupies no slot.
+	block := make(chan struct{})
+	b.Add(func(ctx context.Context) error {
+		<-block
+		return errors.New("boom")
+	})
+
+	b.SetLimit(1)
+
+	// Occupy the only slot until the end of the test, so that it is not
+	// freed when the first function returns.
+	hold := make(chan struct{})
+	b.Add(func(ctx context.Context) error {
+		<-hold
+		return nil
+	})
+
+	ran := make(chan struct{})
+	addDone := make(chan struct{})
+	go func() {
+		b.Add(func(ctx context.Context) error {
+			close(ran)
+			return ctx.Err()
+		})
+		close(addDone)
+	}()
+
+	// Give the third Add a chance to block on the (held) semaphore slot.
+	time.Sleep(20 * time.Millisecond)
+
+	// Release the first function; it errors out and cancels the bundle's
+	// context while the slot is still held. The third Add should now invoke
+	// its function rather than block on the slot forever.
+	close(block)
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("third Add's function never ran; Add appears to have deadlocked")
+	}
+
+	<-addDone
+	close(hold)
+	b.Join()
+}
+
+func TestBundleSetLimitZeroPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected SetLimit(0) to panic")
+		}
+	}()
+
+	NewBundle(nil).SetLimit(0)
+}
+
+func TestBundleCollectAllErrorsAfterAddPanics(t *testing.T) {
+	b := NewBundle(nil)
+	b.Add(func(ctx context.Context) error { return nil })
+	b.Join()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected CollectAllErrors to panic after a function was added")
+		}
+	}()
+
+	b.CollectAllErrors()
+}
+
+func TestBundlePanicSurfacesThroughJoin(t *testing.T) {
+	b := NewBundle(nil)
+	b.Add(func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	err := b.Join()
+	if err == nil {
+		t.Fatal("expected Join to return an error for the panic")
+	}
+
+	if !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Join() error = %q, want it to mention the panic value", err.Error())
+	}
+}
+
+func TestBundleCollectAllErrors(t *testing.T) {
+	b := NewBundle(nil)
+	b.CollectAllErrors()
+
+	errA := errors.New("a")
+	errB := errors.New("b")
+
+	b.Add(func(ctx context.Context) error { return errA })
+	b.Add(func(ctx context.Context) error { return errB })
+	b.Add(func(ctx context.Context) error { return nil })
+
+	err := b.Join()
+	if err == nil {
+		t.Fatal("expected a non-nil aggregate error")
+	}
+
+	u, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatal("Join() error does not implement Unwrap() []error")
+	}
+
+	got := u.Unwrap()
+	if len(got) != 2 {
+		t.Fatalf("Unwrap() returned %d errors, want 2", len(got))
+	}
+
+	seen := map[error]bool{got[0]: true, got[1]: true}
+	if !seen[errA] || !seen[errB] {
+		t.Errorf("Unwrap() = %v, want it to contain %v and %v", got, errA, errB)
+	}
+
+	if errs := b.Errors(); len(errs) != 2 {
+		t.Errorf("Errors() returned %d errors, want 2", len(errs))
+	}
+}
+
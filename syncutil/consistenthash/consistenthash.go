@@ -0,0 +1,94 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consistenthash implements a ring-based consistent hash, suitable
+// for sharding work -- e.g. per-object GCS calls made from syncutil.Bundle
+// workers -- across a set of keys (such as worker names) in a way that
+// changes minimally as keys are added or removed.
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// Hash hashes the given data to a point on the ring.
+type Hash func(data []byte) uint32
+
+// Map is a consistent hash ring mapping arbitrary query keys onto a set of
+// real keys that have been added to it. It is not safe for concurrent use.
+type Map struct {
+	hash     Hash
+	replicas int
+	keys     []int          // Sorted hashes of all virtual nodes.
+	hashMap  map[int]string // Virtual node hash -> real key.
+}
+
+// New creates a new Map with replicas virtual nodes per added key, using fn
+// to hash keys. If fn is nil, CRC32-IEEE is used.
+func New(replicas int, fn Hash) *Map {
+	m := &Map{
+		replicas: replicas,
+		hash:     fn,
+		hashMap:  make(map[int]string),
+	}
+
+	if m.hash == nil {
+		m.hash = crc32.ChecksumIEEE
+	}
+
+	return m
+}
+
+// IsEmpty returns true iff the map has no keys added.
+func (m *Map) IsEmpty() bool {
+	return len(m.keys) == 0
+}
+
+// Add adds the given real keys to the ring, each as m.replicas virtual
+// nodes.
+func (m *Map) Add(keys ...string) {
+	for _, key := range keys {
+		for i := 0; i < m.replicas; i++ {
+			hash := int(m.hash([]byte(fmt.Sprintf("%d%s", i, key))))
+			m.keys = append(m.keys, hash)
+			m.hashMap[hash] = key
+		}
+	}
+
+	sort.Ints(m.keys)
+}
+
+// Get returns the real key that the given query key is assigned to: the
+// closest virtual node clockwise around the ring from the query key's own
+// hash, wrapping around to the first node if the query hash is greater
+// than all of them. It returns the empty string if the map is empty.
+func (m *Map) Get(key string) string {
+	if m.IsEmpty() {
+		return ""
+	}
+
+	hash := int(m.hash([]byte(key)))
+
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+
+	if idx == len(m.keys) {
+		idx = 0
+	}
+
+	return m.hashMap[m.keys[idx]]
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consistenthash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEmptyMapReturnsEmptyString(t *testing.T) {
+	m := New(3, nil)
+
+	if !m.IsEmpty() {
+		t.Errorf("IsEmpty() = false on a fresh Map")
+	}
+
+	if got := m.Get("anything"); got != "" {
+		t.Errorf("Get() = %q, want empty string", got)
+	}
+}
+
+func TestGetIsStableAcrossCalls(t *testing.T) {
+	m := New(10, nil)
+	m.Add("worker-a", "worker-b", "worker-c")
+
+	keys := []string{"foo", "bar", "baz", "qux", "quux"}
+	for _, key := range keys {
+		first := m.Get(key)
+		for i := 0; i < 10; i++ {
+			if got := m.Get(key); got != first {
+				t.Errorf("Get(%q) = %q on call %d, want stable %q", key, got, i, first)
+			}
+		}
+	}
+}
+
+func TestGetDistributesAcrossAddedKeys(t *testing.T) {
+	m := New(50, nil)
+	m.Add("worker-a", "worker-b", "worker-c")
+
+	counts := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("query-%d", i)
+		counts[m.Get(key)]++
+	}
+
+	if len(counts) != 3 {
+		t.Fatalf("queries landed on %d real keys, want all 3; counts = %v", len(counts), counts)
+	}
+
+	for k, c := range counts {
+		if c == 0 {
+			t.Errorf("real key %q received no queries", k)
+		}
+	}
+}
+
+func TestGetIsUnaffectedByUnrelatedAdditions(t *testing.T) {
+	m := New(10, nil)
+	m.Add("worker-a", "worker-b")
+
+	before := make(map[string]string)
+	keys := []string{"foo", "bar", "baz", "qux"}
+	for _, key := range keys {
+		before[key] = m.Get(key)
+	}
+
+	m.Add("worker-c")
+
+	moved := 0
+	for _, key := range keys {
+		if m.Get(key) != before[key] {
+			moved++
+		}
+	}
+
+	// Consistent hashing's whole point is that adding a key only reassigns a
+	// minority of existing queries; with 3 real keys afterward, at most
+	// roughly a third should move.
+	if moved > len(keys)/3 {
+		t.Errorf("adding a key moved %d/%d queries, want a minority", moved, len(keys))
+	}
+}
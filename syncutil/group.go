@@ -0,0 +1,111 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncutil
+
+import "sync"
+
+// A Group deduplicates concurrent calls to a function on behalf of callers
+// that share the same key, in the spirit of groupcache's singleflight
+// package. This is useful for collapsing thundering-herd requests -- for
+// example several callers racing to stat or read the same GCS object --
+// into a single underlying call whose result is shared with everyone who
+// asked for it while it was in flight.
+//
+// The zero value for a Group is usable.
+type Group struct {
+	mu sync.Mutex       // Guards calls.
+	m  map[string]*call // Lazily initialized.
+}
+
+// call is an in-flight or completed Do call.
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Do executes and returns the results of the given function, making sure
+// that only one execution is in flight for a given key at a time. If a
+// duplicate comes in, the duplicate caller waits for the original to
+// complete and receives the same results. The return value shared is true
+// for a duplicate caller that received another caller's result, and false
+// for the caller whose own call to fn produced it.
+func (g *Group) Do(
+	key string,
+	fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	// Forget may have let a newer call for key take this one's place; leave
+	// that one for its own duplicates to find.
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+
+	return c.val, c.err, false
+}
+
+// Result is the result of a Do call, delivered to a DoChan caller.
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
+// DoChan is like Do, but returns a channel that will receive the result when
+// it is ready, allowing the caller to select on it alongside e.g. a
+// context's Done channel. The channel is closed after the single result is
+// sent.
+func (g *Group) DoChan(
+	key string,
+	fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+
+	go func() {
+		v, err, shared := g.Do(key, fn)
+		ch <- Result{Val: v, Err: err, Shared: shared}
+		close(ch)
+	}()
+
+	return ch
+}
+
+// Forget tells the Group to forget about the given key, so that the next
+// call for it -- whether already in flight or not -- will be treated as the
+// first call and will not share its result with callers that started
+// before Forget was called.
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.m, key)
+}
@@ -0,0 +1,145 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncutil
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupDoDeduplicatesConcurrentCallers(t *testing.T) {
+	var g Group
+	var calls int32
+
+	start := make(chan struct{})
+	release := make(chan struct{})
+
+	const n = 10
+	results := make(chan int, n)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+
+			<-start
+			v, err, _ := g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 17, nil
+			})
+
+			if err != nil {
+				t.Errorf("Do: %v", err)
+				return
+			}
+
+			results <- v.(int)
+		}()
+	}
+
+	close(start)
+	time.Sleep(20 * time.Millisecond) // Let everyone pile up behind the first caller.
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fn was called %d times, want 1", got)
+	}
+
+	for v := range results {
+		if v != 17 {
+			t.Errorf("result = %d, want 17", v)
+		}
+	}
+}
+
+func TestGroupForgetStartsFreshCall(t *testing.T) {
+	var g Group
+	var calls int32
+
+	fn := func() (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	// Hold the first call in flight, so that without Forget the second call
+	// would join it rather than run fn itself.
+	type result struct {
+		v      interface{}
+		shared bool
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan result, 1)
+	go func() {
+		v, _, shared := g.Do("key", func() (interface{}, error) {
+			close(started)
+			<-release
+			return fn()
+		})
+		first <- result{v, shared}
+	}()
+	<-started
+
+	g.Forget("key")
+
+	v2, _, shared2 := g.Do("key", fn)
+	close(release)
+
+	r1 := <-first
+	v1, shared1 := r1.v, r1.shared
+	if shared1 {
+		t.Errorf("first call reported shared = true")
+	}
+
+	if shared2 {
+		t.Errorf("call after Forget reported shared = true")
+	}
+
+	if v1 == v2 {
+		t.Errorf("expected Forget to cause a fresh call; got %v both times", v1)
+	}
+}
+
+func TestGroupDoChanDeliversOneResult(t *testing.T) {
+	var g Group
+
+	ch := g.DoChan("key", func() (interface{}, error) {
+		return "value", nil
+	})
+
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed before delivering a result")
+		}
+		if res.Val != "value" || res.Err != nil {
+			t.Errorf("got %+v, want Val=\"value\", Err=nil", res)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatal("DoChan never delivered a result")
+	}
+
+	if _, ok := <-ch; ok {
+		t.Error("channel delivered a second value instead of closing")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lru implements a bounded, in-process cache that evicts the least
+// recently used entry once it grows beyond a configured size.
+//
+// The implementation is not safe for concurrent use; callers that need
+// thread safety should use the tslru sub-package, which wraps a Cache with
+// a syncutil.InvariantMutex.
+package lru
+
+import "container/list"
+
+// Cache is an LRU cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before an item is
+	// evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be executed when
+	// an entry is purged from the cache.
+	OnEvicted func(key, value interface{})
+
+	ll    *list.List
+	cache map[interface{}]*list.Element
+}
+
+// entry is the value stored in each list element.
+type entry struct {
+	key   interface{}
+	value interface{}
+}
+
+// New creates a new Cache that evicts entries once it holds more than
+// maxEntries. A maxEntries of zero means no limit.
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntries: maxEntries,
+		ll:         list.New(),
+		cache:      make(map[interface{}]*list.Element),
+	}
+}
+
+// Add inserts or updates a value for key, marking it as the most recently
+// used entry, and evicts the oldest entry if the cache has grown beyond
+// MaxEntries.
+func (c *Cache) Add(key, value interface{}) {
+	if c.cache == nil {
+		c.cache = make(map[interface{}]*list.Element)
+		c.ll = list.New()
+	}
+
+	if ee, ok := c.cache[key]; ok {
+		c.ll.MoveToFront(ee)
+		ee.Value.(*entry).value = value
+		return
+	}
+
+	ele := c.ll.PushFront(&entry{key, value})
+	c.cache[key] = ele
+
+	if c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries {
+		c.RemoveOldest()
+	}
+}
+
+// Get looks up a key's value from the cache, marking it as the most
+// recently used entry if found.
+func (c *Cache) Get(key interface{}) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+
+	if ele, hit := c.cache[key]; hit {
+		c.ll.MoveToFront(ele)
+		return ele.Value.(*entry).value, true
+	}
+
+	return
+}
+
+// Remove removes the given key from the cache, if present.
+func (c *Cache) Remove(key interface{}) {
+	if c.cache == nil {
+		return
+	}
+
+	if ele, hit := c.cache[key]; hit {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveOldest removes the oldest entry from the cache, if any.
+func (c *Cache) RemoveOldest() {
+	if c.cache == nil {
+		return
+	}
+
+	if ele := c.ll.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	kv := e.Value.(*entry)
+	delete(c.cache, kv.key)
+
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Sizes returns the number of entries in the cache's backing map and list.
+// The two must always agree; it exists for callers (such as tslru) that
+// want to assert that invariant themselves.
+func (c *Cache) Sizes() (mapLen, listLen int) {
+	if c.cache == nil {
+		return 0, 0
+	}
+
+	return len(c.cache), c.ll.Len()
+}
+
+// Len returns the number of items currently in the cache.
+func (c *Cache) Len() int {
+	if c.cache == nil {
+		return 0
+	}
+
+	return c.ll.Len()
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import "testing"
+
+func TestAddAndGet(t *testing.T) {
+	c := New(0)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v, want 1, true", v, ok)
+	}
+
+	if v, ok := c.Get("b"); !ok || v != 2 {
+		t.Errorf("Get(b) = %v, %v, want 2, true", v, ok)
+	}
+
+	if _, ok := c.Get("c"); ok {
+		t.Errorf("Get(c) = _, true, want false")
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// Touch "a" so that "b" becomes the least recently used entry.
+	c.Get("a")
+
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Get(b) = _, true, want false (should have been evicted)")
+	}
+
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("Get(a) = _, false, want true (should still be present)")
+	}
+
+	if _, ok := c.Get("c"); !ok {
+		t.Errorf("Get(c) = _, false, want true")
+	}
+
+	if got := c.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+}
+
+func TestOnEvictedCalledWithEvictedEntry(t *testing.T) {
+	c := New(1)
+
+	var gotKey, gotValue interface{}
+	c.OnEvicted = func(key, value interface{}) {
+		gotKey, gotValue = key, value
+	}
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	if gotKey != "a" || gotValue != 1 {
+		t.Errorf("OnEvicted called with (%v, %v), want (a, 1)", gotKey, gotValue)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := New(0)
+
+	c.Add("a", 1)
+	c.Remove("a")
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get(a) = _, true, want false after Remove")
+	}
+
+	if got := c.Len(); got != 0 {
+		t.Errorf("Len() = %d, want 0", got)
+	}
+}
+
+func TestSizesAgreeWithLen(t *testing.T) {
+	c := New(0)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Remove("a")
+
+	mapLen, listLen := c.Sizes()
+	if mapLen != listLen {
+		t.Errorf("Sizes() = %d, %d, want them equal", mapLen, listLen)
+	}
+
+	if got := c.Len(); got != listLen {
+		t.Errorf("Len() = %d, want it to agree with Sizes()'s list length %d", got, listLen)
+	}
+}
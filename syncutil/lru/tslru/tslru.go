@@ -0,0 +1,114 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tslru provides a thread-safe wrapper around lru.Cache.
+package tslru
+
+import (
+	"fmt"
+
+	"github.com/jacobsa/syncutil"
+	"github.com/jacobsa/syncutil/syncutil/lru"
+)
+
+// Cache is a thread-safe LRU cache, guarding an underlying lru.Cache with a
+// syncutil.InvariantMutex so that -syncutil.check_invariants can catch bugs
+// in callers sharing it across goroutines.
+type Cache struct {
+	mu syncutil.InvariantMutex
+
+	// INVARIANT: the two values returned by wrapped.Sizes() are equal
+	// INVARIANT: maxEntries == 0 || wrapped.Len() <= maxEntries
+	maxEntries int        // GUARDED_BY(mu)
+	wrapped    *lru.Cache // GUARDED_BY(mu)
+}
+
+// New creates a new thread-safe Cache that evicts entries once it holds
+// more than maxEntries. A maxEntries of zero means no limit.
+func New(maxEntries int) *Cache {
+	c := &Cache{
+		maxEntries: maxEntries,
+		wrapped:    lru.New(maxEntries),
+	}
+
+	c.mu = syncutil.NewInvariantMutex(c.checkInvariants)
+	return c
+}
+
+func (c *Cache) checkInvariants() {
+	mapLen, listLen := c.wrapped.Sizes()
+	if mapLen != listLen {
+		panic(fmt.Sprintf(
+			"lru cache's map has %d entries but its list has %d",
+			mapLen,
+			listLen))
+	}
+
+	if c.maxEntries != 0 && listLen > c.maxEntries {
+		panic(fmt.Sprintf(
+			"Len() is %d, which exceeds maxEntries %d",
+			listLen,
+			c.maxEntries))
+	}
+}
+
+// SetOnEvicted installs a callback to be executed, with the lock held, when
+// an entry is purged from the cache.
+func (c *Cache) SetOnEvicted(f func(key, value interface{})) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wrapped.OnEvicted = f
+}
+
+// Add inserts or updates a value for key. See lru.Cache.Add for details.
+func (c *Cache) Add(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wrapped.Add(key, value)
+}
+
+// Get looks up a key's value. Note that this takes the full (write) lock,
+// not a read lock, because a hit mutates the underlying recency list.
+func (c *Cache) Get(key interface{}) (value interface{}, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.wrapped.Get(key)
+}
+
+// Remove removes the given key from the cache, if present.
+func (c *Cache) Remove(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wrapped.Remove(key)
+}
+
+// RemoveOldest removes the oldest entry from the cache, if any.
+func (c *Cache) RemoveOldest() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wrapped.RemoveOldest()
+}
+
+// Len returns the number of items currently in the cache.
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.wrapped.Len()
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tslru
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestAddGetRemove(t *testing.T) {
+	c := New(0)
+
+	c.Add("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v, want 1, true", v, ok)
+	}
+
+	c.Remove("a")
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Get(a) = _, true, want false after Remove")
+	}
+}
+
+func TestEvictsOldestWhenOverMaxEntries(t *testing.T) {
+	c := New(1)
+
+	var evictedKey interface{}
+	c.SetOnEvicted(func(key, value interface{}) {
+		evictedKey = key
+	})
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	if evictedKey != "a" {
+		t.Errorf("evicted key = %v, want a", evictedKey)
+	}
+
+	if got := c.Len(); got != 1 {
+		t.Errorf("Len() = %d, want 1", got)
+	}
+}
+
+// TestInvariantViolationPanics exercises checkInvariants by corrupting a
+// Cache's maxEntries bookkeeping out from under it -- something that should
+// never happen in correctly-written caller code, but which -check_invariants
+// is meant to catch immediately rather than let manifest as a subtler bug
+// later. The flag must be enabled for checkInvariants to run at all; see
+// invariant_mutex.go.
+func TestInvariantViolationPanics(t *testing.T) {
+	if err := flag.Set("syncutil.check_invariants", "true"); err != nil {
+		t.Fatalf("enabling -syncutil.check_invariants: %v", err)
+	}
+	defer flag.Set("syncutil.check_invariants", "false")
+
+	c := New(2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// Violate the maxEntries invariant directly; only a buggy Cache method
+	// would ever do this for real.
+	c.maxEntries = 1
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected Get to panic on the next invariant check")
+		}
+	}()
+
+	c.Get("a")
+}